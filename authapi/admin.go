@@ -0,0 +1,119 @@
+package authapi
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+// maxFailedLoginAttempts is how many failed logins within
+// failedLoginWindow lock an account out of further attempts.
+const maxFailedLoginAttempts = 5
+
+// failedLoginWindow is the rolling window failed logins are counted over.
+const failedLoginWindow = 15 * time.Minute
+
+// isAccountLocked reports whether userID has hit the failed-login threshold
+// within the last failedLoginWindow.
+func isAccountLocked(ctx context.Context, userID int64) (bool, error) {
+	var count int
+	err := db.QueryRow(ctx, `
+		SELECT count(*) FROM audit_events
+		WHERE user_id = $1 AND event_type = 'login_failed' AND created_at > $2
+	`, userID, time.Now().Add(-failedLoginWindow)).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count >= maxFailedLoginAttempts, nil
+}
+
+// requireAdmin verifies the authenticated caller has the "admin" role.
+func requireAdmin(ctx context.Context) (*UserData, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+
+	var role string
+	if err := db.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, data.UserID).Scan(&role); err != nil {
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to check permissions"}
+	}
+	if role != "admin" {
+		return nil, &errs.Error{Code: errs.PermissionDenied, Message: "admin access required"}
+	}
+	return data, nil
+}
+
+// AuditQueryParams filters the admin audit log. All filters are optional;
+// Cursor/Limit implement keyset pagination over descending audit_events.id.
+type AuditQueryParams struct {
+	UserID    *int64     `query:"user_id"`
+	EventType string     `query:"event_type"`
+	Since     *time.Time `query:"since"`
+	Until     *time.Time `query:"until"`
+	Cursor    int64      `query:"cursor"`
+	Limit     int        `query:"limit"`
+}
+
+// AuditEvent is a single row returned by GET /admin/audit.
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	UserID    *int64          `json:"user_id,omitempty"`
+	ActorIP   string          `json:"actor_ip,omitempty"`
+	EventType string          `json:"event_type"`
+	Resource  string          `json:"resource,omitempty"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditQueryResponse is a page of audit events, newest first.
+type AuditQueryResponse struct {
+	Events     []AuditEvent `json:"events"`
+	NextCursor int64        `json:"next_cursor,omitempty"`
+}
+
+//encore:api auth method=GET path=/admin/audit
+func QueryAuditLog(ctx context.Context, params *AuditQueryParams) (*AuditQueryResponse, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	limit := params.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, user_id, actor_ip, event_type, resource, metadata, created_at
+		FROM audit_events
+		WHERE ($1::bigint IS NULL OR user_id = $1)
+		  AND ($2 = '' OR event_type = $2)
+		  AND ($3::timestamptz IS NULL OR created_at >= $3)
+		  AND ($4::timestamptz IS NULL OR created_at <= $4)
+		  AND ($5 = 0 OR id < $5)
+		ORDER BY id DESC
+		LIMIT $6
+	`, params.UserID, params.EventType, params.Since, params.Until, params.Cursor, limit)
+	if err != nil {
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to query audit log"}
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.ActorIP, &e.EventType, &e.Resource, &e.Metadata, &e.CreatedAt); err != nil {
+			return nil, &errs.Error{Code: errs.Internal, Message: "failed to query audit log"}
+		}
+		events = append(events, e)
+	}
+
+	resp := &AuditQueryResponse{Events: events}
+	if len(events) == limit {
+		resp.NextCursor = events[len(events)-1].ID
+	}
+	return resp, nil
+}
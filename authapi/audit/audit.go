@@ -0,0 +1,49 @@
+// Package audit records security-relevant events for the authapi service.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// db references the authapi service's database from this subpackage.
+var db = sqldb.Named("authapi")
+
+// Event describes a single audit log entry.
+type Event struct {
+	UserID    *int64 // nil when the actor could not be identified (e.g. unknown email on login)
+	ActorIP   string
+	UserAgent string
+	Type      string // e.g. "login_success", "login_failed", "key_created"
+	Resource  string // e.g. an API key ID or MFA
+	Metadata  map[string]any
+}
+
+// Record persists an audit event. Failures are logged but never returned,
+// since a broken audit trail should not block the action it's recording.
+func Record(ctx context.Context, e Event) {
+	metadata := e.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	if e.UserAgent != "" {
+		metadata["user_agent"] = e.UserAgent
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		rlog.Error("failed to marshal audit metadata", "error", err, "event_type", e.Type)
+		metadataJSON = []byte("{}")
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO audit_events (user_id, actor_ip, event_type, resource, metadata)
+		VALUES ($1, $2, $3, $4, $5)
+	`, e.UserID, e.ActorIP, e.Type, e.Resource, metadataJSON)
+	if err != nil {
+		rlog.Error("failed to record audit event", "error", err, "event_type", e.Type)
+	}
+}
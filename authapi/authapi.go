@@ -2,11 +2,11 @@ package authapi
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"fmt"
 	"strings"
 
+	"encore-secure-api-backend/authapi/audit"
+
 	"encore.dev/beta/auth"
 	"encore.dev/beta/errs"
 	"encore.dev/rlog"
@@ -27,7 +27,6 @@ type User struct {
 	ID       int64  `sql:"id"`
 	Email    string `sql:"email"`
 	Password string `sql:"password"`
-	APIKey   string `sql:"api_key"`
 }
 
 // SignupParams for account creation
@@ -36,9 +35,10 @@ type SignupParams struct {
 	Password string `json:"password"`
 }
 
-// SignupResponse with the generated API key
+// SignupResponse with a JWT session token pair. To call the API with a
+// long-lived, scoped credential instead, create one via POST /keys.
 type SignupResponse struct {
-	APIKey string `json:"api_key"`
+	TokenPair
 }
 
 // LoginParams for user authentication
@@ -47,9 +47,13 @@ type LoginParams struct {
 	Password string `json:"password"`
 }
 
-// LoginResponse contains the API key
+// LoginResponse contains a JWT session token pair, unless the account has
+// MFA enabled, in which case it carries a short-lived challenge token to be
+// redeemed via POST /login/mfa instead.
 type LoginResponse struct {
-	APIKey string `json:"api_key"`
+	TokenPair
+	MFARequired       bool   `json:"mfa_required,omitempty"`
+	MFAChallengeToken string `json:"mfa_challenge_token,omitempty"`
 }
 
 // RegenerateKeyResponse contains the new API key
@@ -57,16 +61,6 @@ type RegenerateKeyResponse struct {
 	NewAPIKey string `json:"new_api_key"`
 }
 
-// generateAPIKey generates a unique API key with the prefix "esk_"
-func generateAPIKey() (string, error) {
-	// Generate 16 bytes of random data (32 characters when hex-encoded)
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return "esk_" + hex.EncodeToString(bytes), nil
-}
-
 //encore:api public method=POST path=/signup
 func Signup(ctx context.Context, params *SignupParams) (*SignupResponse, error) {
 	// Validate input
@@ -76,11 +70,8 @@ func Signup(ctx context.Context, params *SignupParams) (*SignupResponse, error)
 			Message: "valid email is required",
 		}
 	}
-	if params.Password == "" || len(params.Password) < 8 {
-		return nil, &errs.Error{
-			Code:    errs.InvalidArgument,
-			Message: "password must be at least 8 characters",
-		}
+	if err := validatePasswordStrength(params.Password); err != nil {
+		return nil, err
 	}
 
 	// Hash password
@@ -93,22 +84,12 @@ func Signup(ctx context.Context, params *SignupParams) (*SignupResponse, error)
 		}
 	}
 
-	// Generate API key
-	apiKey, err := generateAPIKey()
-	if err != nil {
-		rlog.Error("failed to generate API key", "error", err)
-		return nil, &errs.Error{
-			Code:    errs.Internal,
-			Message: "failed to generate API key",
-		}
-	}
-
 	// Insert user into database
 	result, err := db.Exec(ctx, `
-		INSERT INTO users (email, password, api_key)
-		VALUES ($1, $2, $3)
+		INSERT INTO users (email, password)
+		VALUES ($1, $2)
 		ON CONFLICT (email) DO NOTHING
-	`, params.Email, string(hashedPw), apiKey)
+	`, params.Email, string(hashedPw))
 	if err != nil {
 		rlog.Error("database insert failed", "error", err, "email", params.Email)
 		return nil, &errs.Error{
@@ -125,8 +106,31 @@ func Signup(ctx context.Context, params *SignupParams) (*SignupResponse, error)
 		}
 	}
 
-	// Return the API key directly since we just created it
-	return &SignupResponse{APIKey: apiKey}, nil
+	var user User
+	err = db.QueryRow(ctx, `
+		SELECT id, email, password FROM users WHERE email = $1
+	`, params.Email).Scan(&user.ID, &user.Email, &user.Password)
+	if err != nil {
+		rlog.Error("failed to load newly created user", "error", err, "email", params.Email)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "failed to create user",
+		}
+	}
+
+	pair, err := issueTokenPair(ctx, user)
+	if err != nil {
+		rlog.Error("failed to issue token pair", "error", err, "email", params.Email)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "failed to issue session tokens",
+		}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &user.ID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "signup", Resource: user.Email})
+
+	return &SignupResponse{TokenPair: *pair}, nil
 }
 
 //encore:api public method=POST path=/login
@@ -138,88 +142,108 @@ func Login(ctx context.Context, params *LoginParams) (*LoginResponse, error) {
 		}
 	}
 
+	meta := requestMetaFromContext(ctx)
+
 	var user User
 	err := db.QueryRow(ctx, `
-		SELECT id, email, password, api_key
+		SELECT id, email, password
 		FROM users
 		WHERE email = $1
-	`, params.Email).Scan(&user.ID, &user.Email, &user.Password, &user.APIKey)
+	`, params.Email).Scan(&user.ID, &user.Email, &user.Password)
 	if err != nil {
+		audit.Record(ctx, audit.Event{ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "login_failed", Resource: params.Email})
 		return nil, &errs.Error{
 			Code:    errs.Unauthenticated,
 			Message: "invalid credentials",
 		}
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(params.Password)); err != nil {
+	locked, err := isAccountLocked(ctx, user.ID)
+	if err != nil {
+		rlog.Error("failed to check account lock status", "error", err, "email", params.Email)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "failed to check account status",
+		}
+	}
+	if locked {
+		audit.Record(ctx, audit.Event{UserID: &user.ID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "login_locked", Resource: user.Email})
 		return nil, &errs.Error{
 			Code:    errs.Unauthenticated,
-			Message: "invalid credentials",
+			Message: "account temporarily locked due to too many failed login attempts",
 		}
 	}
 
-	return &LoginResponse{APIKey: user.APIKey}, nil
-}
-
-//encore:api auth method=POST path=/regenerate-key
-func RegenerateKey(ctx context.Context) (*RegenerateKeyResponse, error) {
-	userID, ok := auth.UserID()
-	if !ok {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(params.Password)); err != nil {
+		audit.Record(ctx, audit.Event{UserID: &user.ID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "login_failed", Resource: user.Email})
 		return nil, &errs.Error{
 			Code:    errs.Unauthenticated,
-			Message: "user not authenticated",
+			Message: "invalid credentials",
 		}
 	}
 
-	newKey, err := generateAPIKey()
-	if err != nil {
+	var mfaConfirmed bool
+	err = db.QueryRow(ctx, `
+		SELECT confirmed FROM user_mfa WHERE user_id = $1
+	`, user.ID).Scan(&mfaConfirmed)
+	if err != nil && err != sqldb.ErrNoRows {
+		rlog.Error("failed to check MFA status", "error", err, "email", params.Email)
 		return nil, &errs.Error{
 			Code:    errs.Internal,
-			Message: "failed to generate new key",
+			Message: "failed to check MFA status",
+		}
+	}
+	if mfaConfirmed {
+		challenge, err := generateMFAChallengeToken(user)
+		if err != nil {
+			rlog.Error("failed to generate MFA challenge", "error", err, "email", params.Email)
+			return nil, &errs.Error{
+				Code:    errs.Internal,
+				Message: "failed to start MFA challenge",
+			}
 		}
+		audit.Record(ctx, audit.Event{UserID: &user.ID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "login_mfa_challenge", Resource: user.Email})
+		return &LoginResponse{MFARequired: true, MFAChallengeToken: challenge}, nil
 	}
 
-	_, err = db.Exec(ctx, `
-		UPDATE users
-		SET api_key = $1
-		WHERE email = $2
-	`, newKey, string(userID))
+	pair, err := issueTokenPair(ctx, user)
 	if err != nil {
+		rlog.Error("failed to issue token pair", "error", err, "email", params.Email)
 		return nil, &errs.Error{
 			Code:    errs.Internal,
-			Message: "failed to update key",
+			Message: "failed to issue session tokens",
 		}
 	}
 
-	return &RegenerateKeyResponse{NewAPIKey: newKey}, nil
+	audit.Record(ctx, audit.Event{UserID: &user.ID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "login_success", Resource: user.Email})
+
+	return &LoginResponse{TokenPair: *pair}, nil
 }
 
 //encore:authhandler
-func AuthHandler(ctx context.Context, apiKey string) (auth.UID, error) {
-	// Validate API key format
-	if !strings.HasPrefix(apiKey, "esk_") || len(apiKey) < 8 {
-		return "", &errs.Error{
-			Code:    errs.Unauthenticated,
-			Message: "invalid API key format; must start with 'esk_'",
-		}
+func AuthHandler(ctx context.Context, token string) (auth.UID, *UserData, error) {
+	if strings.HasPrefix(token, "esk_live_") {
+		return authenticateAPIKey(ctx, token)
 	}
+	return authenticateJWT(ctx, token)
+}
 
-	// Check if API key exists in the database
-	var user User
-	err := db.QueryRow(ctx, `
-		SELECT id, email, api_key
-		FROM users
-		WHERE api_key = $1
-	`, apiKey).Scan(&user.ID, &user.Email, &user.APIKey)
+// authenticateJWT authenticates a request presenting a "Bearer <jwt>" access token.
+func authenticateJWT(ctx context.Context, token string) (auth.UID, *UserData, error) {
+	claims, err := parseAccessToken(token)
 	if err != nil {
-		return "", &errs.Error{
+		return "", nil, &errs.Error{
 			Code:    errs.Unauthenticated,
-			Message: "invalid API key",
+			Message: "invalid or expired access token",
 		}
 	}
 
-	// Return user ID as the authenticated UID
-	return auth.UID(user.Email), nil
+	return auth.UID(claims.Email), &UserData{
+		UserID:   claims.UserID,
+		Email:    claims.Email,
+		IssuedAt: claims.IssuedAt.Time,
+		Scopes:   []string{"*"},
+	}, nil
 }
 
 // ProtectedParams for the secure endpoint
@@ -249,5 +273,11 @@ func Protected(ctx context.Context, params *ProtectedParams) (*ProtectedResponse
 			Message: "user not authenticated",
 		}
 	}
+
+	if data, ok := auth.Data().(*UserData); ok && data != nil {
+		meta := requestMetaFromContext(ctx)
+		audit.Record(ctx, audit.Event{UserID: &data.UserID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "protected_access"})
+	}
+
 	return &ProtectedResponse{Message: "Protected data for " + string(userID) + ": " + params.Data}, nil
 }
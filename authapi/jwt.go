@@ -0,0 +1,74 @@
+package authapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// secrets holds values injected by Encore's secrets manager.
+var secrets struct {
+	JWTSecret string // HS256 signing secret for access tokens
+}
+
+// accessTokenTTL is how long an issued access token remains valid.
+const accessTokenTTL = 15 * time.Minute
+
+// UserData is attached to the request context by AuthHandler for every
+// authenticated request, regardless of whether the caller used a JWT
+// access token or a static API key.
+type UserData struct {
+	UserID   int64
+	Email    string
+	IssuedAt time.Time
+	// Scopes lists what the credential is allowed to do. A JWT-authenticated
+	// session carries the implicit "*" scope; API keys carry whatever scopes
+	// they were issued with. See RequireScope.
+	Scopes []string
+}
+
+// accessClaims are the JWT claims embedded in an access token. The "typ"
+// claim keeps a different kind of token signed with the same secret (e.g.
+// an MFA challenge token) from being accepted here.
+type accessClaims struct {
+	UserID int64  `json:"uid"`
+	Email  string `json:"email"`
+	Typ    string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// generateAccessToken issues a short-lived JWT access token for the given user.
+func generateAccessToken(user User) (string, error) {
+	now := time.Now()
+	claims := accessClaims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Typ:    "access",
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secrets.JWTSecret))
+}
+
+// parseAccessToken verifies the signature, exp, iat and typ claims of an
+// access token and returns the claims it carries.
+func parseAccessToken(tokenStr string) (*accessClaims, error) {
+	claims := &accessClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(secrets.JWTSecret), nil
+	}, jwt.WithIssuedAt())
+	if err != nil || !token.Valid || claims.Typ != "access" {
+		return nil, fmt.Errorf("invalid access token: %w", err)
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("access token missing iat/exp claims")
+	}
+	return claims, nil
+}
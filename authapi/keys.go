@@ -0,0 +1,286 @@
+package authapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"encore-secure-api-backend/authapi/audit"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// APIKey mirrors a row of the api_keys table. The raw key is never stored;
+// only its hash and a short prefix (for lookup and display) are.
+type APIKey struct {
+	ID                 int64      `json:"id"`
+	Name               string     `json:"name"`
+	Prefix             string     `json:"prefix"`
+	Scopes             []string   `json:"scopes"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// keyPrefixLen and keySecretLen control the shape of "esk_live_<prefix>_<secret>".
+const (
+	keyPrefixLen = 8
+	keySecretLen = 24
+)
+
+// generateScopedAPIKey creates a new raw key of the form
+// "esk_live_<prefix>_<secret>" and returns the full key alongside the
+// prefix and hash to persist.
+func generateScopedAPIKey() (fullKey, prefix, hash string, err error) {
+	prefix, err = randomToken(keyPrefixLen / 2)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := randomToken(keySecretLen / 2)
+	if err != nil {
+		return "", "", "", err
+	}
+	fullKey = fmt.Sprintf("esk_live_%s_%s", prefix, secret)
+	return fullKey, prefix, hashToken(secret), nil
+}
+
+// splitScopedAPIKey extracts the prefix and secret from a raw
+// "esk_live_<prefix>_<secret>" key.
+func splitScopedAPIKey(key string) (prefix, secret string, ok bool) {
+	parts := strings.SplitN(key, "_", 4)
+	if len(parts) != 4 || parts[0] != "esk" || parts[1] != "live" {
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
+
+// authenticateAPIKey authenticates a request presenting a scoped
+// "esk_live_<prefix>_<secret>" API key.
+func authenticateAPIKey(ctx context.Context, rawKey string) (auth.UID, *UserData, error) {
+	prefix, secret, ok := splitScopedAPIKey(rawKey)
+	if !ok {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid API key format",
+		}
+	}
+
+	var (
+		id        int64
+		userID    int64
+		email     string
+		keyHash   string
+		scopes    []string
+		expiresAt *time.Time
+		revokedAt *time.Time
+	)
+	err := db.QueryRow(ctx, `
+		SELECT k.id, k.user_id, u.email, k.key_hash, k.scopes, k.expires_at, k.revoked_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_prefix = $1
+	`, prefix).Scan(&id, &userID, &email, &keyHash, &scopes, &expiresAt, &revokedAt)
+	if err != nil {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid API key",
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(keyHash)) != 1 {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid API key",
+		}
+	}
+	if revokedAt != nil {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "API key has been revoked",
+		}
+	}
+	if expiresAt != nil && time.Now().After(*expiresAt) {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "API key has expired",
+		}
+	}
+
+	if _, err := db.Exec(ctx, `UPDATE api_keys SET last_used_at = now() WHERE id = $1`, id); err != nil {
+		rlog.Error("failed to update api key last_used_at", "error", err, "key_id", id)
+	}
+
+	return auth.UID(email), &UserData{UserID: userID, Email: email, Scopes: scopes}, nil
+}
+
+// RequireScope returns a PermissionDenied error unless the authenticated
+// caller's credentials carry the given scope. JWT-authenticated (session)
+// callers hold the implicit "*" scope, since they act as the user directly
+// rather than through a scoped API key.
+func RequireScope(ctx context.Context, scope string) error {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+	for _, s := range data.Scopes {
+		if s == scope || s == "*" {
+			return nil
+		}
+	}
+	return &errs.Error{
+		Code:    errs.PermissionDenied,
+		Message: fmt.Sprintf("missing required scope %q", scope),
+	}
+}
+
+// CreateKeyParams describes a new scoped API key to issue.
+type CreateKeyParams struct {
+	Name               string     `json:"name"`
+	Scopes             []string   `json:"scopes"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute,omitempty"`
+}
+
+// CreateKeyResponse returns the newly issued key. The raw key is only ever
+// shown here; it cannot be retrieved again afterwards.
+type CreateKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+//encore:api auth method=POST path=/keys
+func CreateKey(ctx context.Context, params *CreateKeyParams) (*CreateKeyResponse, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+	if params.Name == "" {
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: "name is required"}
+	}
+
+	rateLimit := params.RateLimitPerMinute
+	if rateLimit <= 0 {
+		rateLimit = 60
+	}
+
+	fullKey, prefix, hash, err := generateScopedAPIKey()
+	if err != nil {
+		rlog.Error("failed to generate api key", "error", err)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to generate key"}
+	}
+
+	var key APIKey
+	err = db.QueryRow(ctx, `
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, rate_limit_per_minute, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, name, key_prefix, scopes, rate_limit_per_minute, expires_at, last_used_at, created_at
+	`, data.UserID, params.Name, prefix, hash, params.Scopes, rateLimit, params.ExpiresAt).Scan(
+		&key.ID, &key.Name, &key.Prefix, &key.Scopes, &key.RateLimitPerMinute, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt,
+	)
+	if err != nil {
+		rlog.Error("failed to insert api key", "error", err, "user_id", data.UserID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to create key"}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &data.UserID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "key_created", Resource: fmt.Sprintf("%d", key.ID)})
+
+	return &CreateKeyResponse{APIKey: key, Key: fullKey}, nil
+}
+
+// ListKeysResponse lists a user's API keys, without their secrets.
+type ListKeysResponse struct {
+	Keys []APIKey `json:"keys"`
+}
+
+//encore:api auth method=GET path=/keys
+func ListKeys(ctx context.Context) (*ListKeysResponse, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, name, key_prefix, scopes, rate_limit_per_minute, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, data.UserID)
+	if err != nil {
+		rlog.Error("failed to list api keys", "error", err, "user_id", data.UserID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to list keys"}
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Scopes, &key.RateLimitPerMinute, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+			rlog.Error("failed to scan api key row", "error", err)
+			return nil, &errs.Error{Code: errs.Internal, Message: "failed to list keys"}
+		}
+		keys = append(keys, key)
+	}
+	return &ListKeysResponse{Keys: keys}, nil
+}
+
+//encore:api auth method=DELETE path=/keys/:id
+func DeleteKey(ctx context.Context, id int64) (*struct{}, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+
+	result, err := db.Exec(ctx, `
+		DELETE FROM api_keys WHERE id = $1 AND user_id = $2
+	`, id, data.UserID)
+	if err != nil {
+		rlog.Error("failed to delete api key", "error", err, "key_id", id)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to delete key"}
+	}
+	if result.RowsAffected() == 0 {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "key not found"}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &data.UserID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "key_revoked", Resource: fmt.Sprintf("%d", id)})
+
+	return &struct{}{}, nil
+}
+
+//encore:api auth method=POST path=/keys/:id/regenerate
+func RegenerateKey(ctx context.Context, id int64) (*RegenerateKeyResponse, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+
+	fullKey, prefix, hash, err := generateScopedAPIKey()
+	if err != nil {
+		rlog.Error("failed to generate api key", "error", err)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to generate new key"}
+	}
+
+	result, err := db.Exec(ctx, `
+		UPDATE api_keys
+		SET key_prefix = $1, key_hash = $2, last_used_at = NULL
+		WHERE id = $3 AND user_id = $4
+	`, prefix, hash, id, data.UserID)
+	if err != nil {
+		rlog.Error("failed to regenerate api key", "error", err, "key_id", id)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to update key"}
+	}
+	if result.RowsAffected() == 0 {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "key not found"}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &data.UserID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "key_regenerated", Resource: fmt.Sprintf("%d", id)})
+
+	return &RegenerateKeyResponse{NewAPIKey: fullKey}, nil
+}
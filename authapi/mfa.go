@@ -0,0 +1,289 @@
+package authapi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"encore-secure-api-backend/authapi/audit"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mfaIssuer is the "issuer" shown by authenticator apps next to the account.
+const mfaIssuer = "EncoreSecureAPI"
+
+// mfaChallengeTTL bounds how long a Login-issued challenge token may be
+// redeemed via /login/mfa before the user has to log in again.
+const mfaChallengeTTL = 5 * time.Minute
+
+// mfaChallengeClaims are the claims embedded in a short-lived challenge
+// token. The "typ" claim keeps it from being accepted as an access token.
+type mfaChallengeClaims struct {
+	UserID int64  `json:"uid"`
+	Email  string `json:"email"`
+	Typ    string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+func generateMFAChallengeToken(user User) (string, error) {
+	now := time.Now()
+	claims := mfaChallengeClaims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Typ:    "mfa_challenge",
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secrets.JWTSecret))
+}
+
+func parseMFAChallengeToken(tokenStr string) (*mfaChallengeClaims, error) {
+	claims := &mfaChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(secrets.JWTSecret), nil
+	})
+	if err != nil || !token.Valid || claims.Typ != "mfa_challenge" {
+		return nil, fmt.Errorf("invalid or expired MFA challenge token")
+	}
+	return claims, nil
+}
+
+// EnrollMFAParams carries the proof required to re-enroll when MFA is
+// already confirmed on the account. It is ignored on a first-time enroll.
+type EnrollMFAParams struct {
+	Code string `json:"code,omitempty"`
+}
+
+// EnrollMFAResponse contains everything an authenticator app needs to add
+// the account.
+type EnrollMFAResponse struct {
+	Secret string `json:"secret"`
+	OTPURI string `json:"otpauth_uri"`
+}
+
+//encore:api auth method=POST path=/mfa/enroll
+func EnrollMFA(ctx context.Context, params *EnrollMFAParams) (*EnrollMFAResponse, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+
+	var alreadyConfirmed bool
+	err := db.QueryRow(ctx, `
+		SELECT confirmed FROM user_mfa WHERE user_id = $1
+	`, data.UserID).Scan(&alreadyConfirmed)
+	if err != nil && err != sqldb.ErrNoRows {
+		rlog.Error("failed to check existing MFA enrollment", "error", err, "user_id", data.UserID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to enroll MFA"}
+	}
+	if alreadyConfirmed {
+		// Re-enrolling would silently turn off MFA protection (the next
+		// Login wouldn't challenge the old device), so require the same
+		// proof DisableMFA does before overwriting the confirmed secret.
+		if err := checkMFACode(ctx, data.UserID, params.Code); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		rlog.Error("failed to generate TOTP secret", "error", err)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to generate MFA secret"}
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO user_mfa (user_id, secret, confirmed, recovery_codes)
+		VALUES ($1, $2, false, '{}')
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, confirmed = false, recovery_codes = '{}'
+	`, data.UserID, secret)
+	if err != nil {
+		rlog.Error("failed to store MFA secret", "error", err, "user_id", data.UserID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to enroll MFA"}
+	}
+
+	uri := fmt.Sprintf(
+		"otpauth://totp/%s:%s?secret=%s&issuer=%s&algorithm=SHA1&digits=6&period=%d",
+		url.PathEscape(mfaIssuer), url.PathEscape(data.Email), secret, url.QueryEscape(mfaIssuer), totpPeriod,
+	)
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &data.UserID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "mfa_enrolled"})
+
+	return &EnrollMFAResponse{Secret: secret, OTPURI: uri}, nil
+}
+
+// VerifyMFAParams carries the TOTP code that confirms enrollment.
+type VerifyMFAParams struct {
+	Code string `json:"code"`
+}
+
+// VerifyMFAResponse returns the one-time recovery codes generated on
+// confirmation. They are only ever shown here.
+type VerifyMFAResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+//encore:api auth method=POST path=/mfa/verify
+func VerifyMFA(ctx context.Context, params *VerifyMFAParams) (*VerifyMFAResponse, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+
+	var secret string
+	err := db.QueryRow(ctx, `
+		SELECT secret FROM user_mfa WHERE user_id = $1
+	`, data.UserID).Scan(&secret)
+	if err != nil {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "MFA has not been enrolled"}
+	}
+
+	if !verifyTOTP(secret, params.Code, time.Now().Unix()) {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid MFA code"}
+	}
+
+	recoveryCodes, hashedCodes, err := generateRecoveryCodes(8)
+	if err != nil {
+		rlog.Error("failed to generate recovery codes", "error", err)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to enable MFA"}
+	}
+
+	_, err = db.Exec(ctx, `
+		UPDATE user_mfa SET confirmed = true, recovery_codes = $1 WHERE user_id = $2
+	`, hashedCodes, data.UserID)
+	if err != nil {
+		rlog.Error("failed to confirm MFA", "error", err, "user_id", data.UserID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to enable MFA"}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &data.UserID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "mfa_verified"})
+
+	return &VerifyMFAResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// DisableMFAParams requires a valid code to prove control of the device
+// before MFA can be turned off.
+type DisableMFAParams struct {
+	Code string `json:"code"`
+}
+
+//encore:api auth method=POST path=/mfa/disable
+func DisableMFA(ctx context.Context, params *DisableMFAParams) (*struct{}, error) {
+	data, ok := auth.Data().(*UserData)
+	if !ok || data == nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "user not authenticated"}
+	}
+
+	if err := checkMFACode(ctx, data.UserID, params.Code); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, data.UserID); err != nil {
+		rlog.Error("failed to disable MFA", "error", err, "user_id", data.UserID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to disable MFA"}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &data.UserID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "mfa_disabled"})
+
+	return &struct{}{}, nil
+}
+
+// LoginMFAParams completes a Login that returned an MFA challenge.
+type LoginMFAParams struct {
+	ChallengeToken string `json:"mfa_challenge_token"`
+	Code           string `json:"code"`
+}
+
+//encore:api public method=POST path=/login/mfa
+func LoginMFA(ctx context.Context, params *LoginMFAParams) (*TokenPair, error) {
+	claims, err := parseMFAChallengeToken(params.ChallengeToken)
+	if err != nil {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid or expired MFA challenge"}
+	}
+
+	if err := checkMFACode(ctx, claims.UserID, params.Code); err != nil {
+		return nil, err
+	}
+
+	var user User
+	err = db.QueryRow(ctx, `
+		SELECT id, email, password FROM users WHERE id = $1
+	`, claims.UserID).Scan(&user.ID, &user.Email, &user.Password)
+	if err != nil {
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to load user"}
+	}
+
+	pair, err := issueTokenPair(ctx, user)
+	if err != nil {
+		rlog.Error("failed to issue token pair", "error", err, "user_id", user.ID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to issue session tokens"}
+	}
+	return pair, nil
+}
+
+// checkMFACode validates code against the user's enrolled TOTP secret or,
+// failing that, consumes a matching recovery code.
+func checkMFACode(ctx context.Context, userID int64, code string) error {
+	var (
+		secret        string
+		recoveryCodes []string
+	)
+	err := db.QueryRow(ctx, `
+		SELECT secret, recovery_codes FROM user_mfa WHERE user_id = $1 AND confirmed = true
+	`, userID).Scan(&secret, &recoveryCodes)
+	if err != nil {
+		return &errs.Error{Code: errs.Unauthenticated, Message: "MFA is not enabled"}
+	}
+
+	if verifyTOTP(secret, code, time.Now().Unix()) {
+		return nil
+	}
+
+	for i, hashed := range recoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hashed), []byte(code)) == nil {
+			remaining := append(recoveryCodes[:i], recoveryCodes[i+1:]...)
+			if _, err := db.Exec(ctx, `
+				UPDATE user_mfa SET recovery_codes = $1 WHERE user_id = $2
+			`, remaining, userID); err != nil {
+				rlog.Error("failed to consume recovery code", "error", err, "user_id", userID)
+			}
+			return nil
+		}
+	}
+
+	return &errs.Error{Code: errs.Unauthenticated, Message: "invalid MFA code"}
+}
+
+// generateRecoveryCodes returns n freshly generated recovery codes along
+// with their bcrypt hashes for storage.
+func generateRecoveryCodes(n int) (codes []string, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		hashed, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, string(hashed))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,53 @@
+package authapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"encore.dev/middleware"
+)
+
+type requestMetaKeyType struct{}
+
+var requestMetaKey requestMetaKeyType
+
+// requestMeta is the caller information the audit log wants for every
+// request: the client IP and User-Agent header.
+type requestMeta struct {
+	IP        string
+	UserAgent string
+}
+
+//encore:middleware target=all
+func CaptureRequestMeta(req middleware.Request, next middleware.Next) middleware.Response {
+	meta := requestMeta{}
+	if httpReq := req.Data().HTTPRequest(); httpReq != nil {
+		meta.IP = clientIP(httpReq)
+		meta.UserAgent = httpReq.UserAgent()
+	}
+	return next(req.WithContext(context.WithValue(req.Context(), requestMetaKey, meta)))
+}
+
+// clientIP prefers the first hop in X-Forwarded-For (set by Encore's
+// gateway) and falls back to the raw connection address.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestMetaFromContext reads back the metadata CaptureRequestMeta stored,
+// defaulting to an empty value outside of a live request (e.g. in tests).
+func requestMetaFromContext(ctx context.Context) requestMeta {
+	if m, ok := ctx.Value(requestMetaKey).(requestMeta); ok {
+		return m
+	}
+	return requestMeta{}
+}
@@ -0,0 +1,68 @@
+package oauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// EncryptToken encrypts a provider access/refresh token with AES-GCM using
+// TokenEncryptionKey, returning a base64-encoded "nonce || ciphertext"
+// blob. An empty input (e.g. a provider that issues no refresh token)
+// round-trips to an empty string without touching the cipher.
+func EncryptToken(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptToken reverses EncryptToken.
+func DecryptToken(encoded string) (string, error) {
+	if encoded == "" {
+		return "", nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted token: %w", err)
+	}
+
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted token too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher([]byte(secrets.TokenEncryptionKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
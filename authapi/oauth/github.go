@@ -0,0 +1,61 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+)
+
+const (
+	githubAuthURL     = "https://github.com/login/oauth/authorize"
+	githubTokenURL    = "https://github.com/login/oauth/access_token"
+	githubUserInfoURL = "https://api.github.com/user"
+	githubEmailsURL   = "https://api.github.com/user/emails"
+)
+
+type githubProvider struct{}
+
+func (p *githubProvider) Name() string { return "github" }
+
+func (p *githubProvider) AuthCodeURL(state, codeChallenge string) string {
+	v := url.Values{}
+	v.Set("client_id", secrets.GitHubClientID)
+	v.Set("redirect_uri", redirectURI(p.Name()))
+	v.Set("scope", "read:user user:email")
+	v.Set("state", state)
+	v.Set("code_challenge", codeChallenge)
+	v.Set("code_challenge_method", "S256")
+	return githubAuthURL + "?" + v.Encode()
+}
+
+func (p *githubProvider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	return exchangeCode(ctx, githubTokenURL, secrets.GitHubClientID, secrets.GitHubClientSecret, code, codeVerifier, p.Name())
+}
+
+func (p *githubProvider) UserInfo(ctx context.Context, token *Token) (*UserInfo, error) {
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := fetchJSON(ctx, githubUserInfoURL, token.AccessToken, &user); err != nil {
+		return nil, err
+	}
+
+	// The primary email always has to be fetched from /user/emails: /user
+	// only exposes it when the user has made it public, and it never
+	// exposes the verified flag we need to trust it for login.
+	var email string
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := fetchJSON(ctx, githubEmailsURL, token.AccessToken, &emails); err == nil {
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				email = e.Email
+				break
+			}
+		}
+	}
+
+	return &UserInfo{ProviderUserID: providerUserID(user.ID), Email: email}, nil
+}
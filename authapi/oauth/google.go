@@ -0,0 +1,43 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+)
+
+const (
+	googleAuthURL     = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+)
+
+type googleProvider struct{}
+
+func (p *googleProvider) Name() string { return "google" }
+
+func (p *googleProvider) AuthCodeURL(state, codeChallenge string) string {
+	v := url.Values{}
+	v.Set("client_id", secrets.GoogleClientID)
+	v.Set("redirect_uri", redirectURI(p.Name()))
+	v.Set("response_type", "code")
+	v.Set("scope", "openid email")
+	v.Set("state", state)
+	v.Set("code_challenge", codeChallenge)
+	v.Set("code_challenge_method", "S256")
+	return googleAuthURL + "?" + v.Encode()
+}
+
+func (p *googleProvider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	return exchangeCode(ctx, googleTokenURL, secrets.GoogleClientID, secrets.GoogleClientSecret, code, codeVerifier, p.Name())
+}
+
+func (p *googleProvider) UserInfo(ctx context.Context, token *Token) (*UserInfo, error) {
+	var body struct {
+		Sub   string `json:"sub"`
+		Email string `json:"email"`
+	}
+	if err := fetchJSON(ctx, googleUserInfoURL, token.AccessToken, &body); err != nil {
+		return nil, err
+	}
+	return &UserInfo{ProviderUserID: body.Sub, Email: body.Email}, nil
+}
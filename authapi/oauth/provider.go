@@ -0,0 +1,61 @@
+// Package oauth implements the OAuth2 authorization-code-with-PKCE flow
+// against pluggable identity providers.
+package oauth
+
+import (
+	"context"
+	"time"
+)
+
+// Token is the access/refresh token pair returned by a provider's token
+// endpoint.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// UserInfo is the subset of a provider's user profile we care about.
+type UserInfo struct {
+	ProviderUserID string
+	Email          string
+}
+
+// Provider implements the OAuth2 authorization-code flow with PKCE against
+// a specific identity provider. New providers are added by implementing
+// this interface and registering it in registry.go, without touching the
+// authapi endpoints that drive the flow.
+type Provider interface {
+	// Name is the provider's identifier, used in URLs and stored on
+	// oauth_identities rows (e.g. "google", "github").
+	Name() string
+	// AuthCodeURL builds the provider's authorization URL for the given
+	// state and PKCE (S256) code challenge.
+	AuthCodeURL(state, codeChallenge string) string
+	// Exchange trades an authorization code and the original PKCE code
+	// verifier for a token pair.
+	Exchange(ctx context.Context, code, codeVerifier string) (*Token, error)
+	// UserInfo fetches the authenticated user's profile from the provider.
+	UserInfo(ctx context.Context, token *Token) (*UserInfo, error)
+}
+
+// secrets holds provider credentials and shared OAuth config, injected by
+// Encore's secrets manager.
+var secrets struct {
+	GoogleClientID     string
+	GoogleClientSecret string
+	GitHubClientID     string
+	GitHubClientSecret string
+
+	// OAuthRedirectBaseURL is the public base URL this service is served
+	// at, used to build each provider's redirect_uri.
+	OAuthRedirectBaseURL string
+	// TokenEncryptionKey is a 32-byte AES-256 key used to encrypt stored
+	// provider tokens at rest.
+	TokenEncryptionKey string
+}
+
+// redirectURI builds the callback URL registered with a provider.
+func redirectURI(provider string) string {
+	return secrets.OAuthRedirectBaseURL + "/auth/oauth/" + provider + "/callback"
+}
@@ -0,0 +1,14 @@
+package oauth
+
+// providers holds one instance per supported identity provider, keyed by
+// the name used in /auth/oauth/:provider/... URLs.
+var providers = map[string]Provider{
+	"google": &googleProvider{},
+	"github": &githubProvider{},
+}
+
+// Get looks up a registered provider by name.
+func Get(name string) (Provider, bool) {
+	p, ok := providers[name]
+	return p, ok
+}
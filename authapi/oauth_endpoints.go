@@ -0,0 +1,250 @@
+package authapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"encore-secure-api-backend/authapi/audit"
+	"encore-secure-api-backend/authapi/oauth"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oauthStateTTL bounds how long a start/callback round-trip may take.
+const oauthStateTTL = 10 * time.Minute
+
+// pkceChallenge derives the S256 PKCE code challenge for a code verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// signOAuthState produces a "<id>.<hmac>" cookie value binding the cookie
+// to the given state ID, so the callback can be sure the state it was
+// handed came from a start call this service issued.
+func signOAuthState(id string) string {
+	mac := hmac.New(sha256.New, []byte(secrets.JWTSecret))
+	mac.Write([]byte(id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyOAuthStateCookie checks that cookie is a validly-signed value for
+// wantID.
+func verifyOAuthStateCookie(cookieHeader, wantID string) bool {
+	for _, part := range strings.Split(cookieHeader, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 || kv[0] != "oauth_state" {
+			continue
+		}
+		pieces := strings.SplitN(kv[1], ".", 2)
+		if len(pieces) != 2 || pieces[0] != wantID {
+			return false
+		}
+		return hmac.Equal([]byte(pieces[1]), []byte(strings.TrimPrefix(signOAuthState(wantID), wantID+".")))
+	}
+	return false
+}
+
+// OAuthStartParams optionally carries the caller's session token, so an
+// already-logged-in user can link a provider account instead of creating
+// a new one.
+type OAuthStartParams struct {
+	Authorization string `header:"Authorization"`
+}
+
+// OAuthStartResponse carries the URL to redirect the user to.
+type OAuthStartResponse struct {
+	RedirectURL string `json:"redirect_url"`
+	State       string `json:"state"`
+	SetCookie   string `header:"Set-Cookie"`
+}
+
+//encore:api public method=GET path=/auth/oauth/:provider/start
+func OAuthStart(ctx context.Context, provider string, params *OAuthStartParams) (*OAuthStartResponse, error) {
+	p, ok := oauth.Get(provider)
+	if !ok {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "unknown OAuth provider"}
+	}
+
+	var linkUserID *int64
+	if tok, found := strings.CutPrefix(params.Authorization, "Bearer "); found {
+		if claims, err := parseAccessToken(tok); err == nil {
+			linkUserID = &claims.UserID
+		}
+	}
+
+	stateID, err := randomToken(16)
+	if err != nil {
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to start OAuth flow"}
+	}
+	codeVerifier, err := randomToken(32)
+	if err != nil {
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to start OAuth flow"}
+	}
+
+	if _, err := db.Exec(ctx, `
+		INSERT INTO oauth_states (id, provider, code_verifier, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, stateID, provider, codeVerifier, linkUserID, time.Now().Add(oauthStateTTL)); err != nil {
+		rlog.Error("failed to store OAuth state", "error", err, "provider", provider)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to start OAuth flow"}
+	}
+
+	return &OAuthStartResponse{
+		RedirectURL: p.AuthCodeURL(stateID, pkceChallenge(codeVerifier)),
+		State:       stateID,
+		SetCookie:   "oauth_state=" + signOAuthState(stateID) + "; HttpOnly; Secure; SameSite=Lax; Max-Age=600",
+	}, nil
+}
+
+// OAuthCallbackParams carries the provider's redirect query params plus
+// the state cookie set by OAuthStart.
+type OAuthCallbackParams struct {
+	Code   string `query:"code"`
+	State  string `query:"state"`
+	Cookie string `header:"Cookie"`
+}
+
+//encore:api public method=GET path=/auth/oauth/:provider/callback
+func OAuthCallback(ctx context.Context, provider string, params *OAuthCallbackParams) (*TokenPair, error) {
+	p, ok := oauth.Get(provider)
+	if !ok {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "unknown OAuth provider"}
+	}
+	if !verifyOAuthStateCookie(params.Cookie, params.State) {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid OAuth state"}
+	}
+
+	var (
+		codeVerifier string
+		linkUserID   *int64
+		expiresAt    time.Time
+	)
+	err := db.QueryRow(ctx, `
+		SELECT code_verifier, link_user_id, expires_at FROM oauth_states
+		WHERE id = $1 AND provider = $2
+	`, params.State, provider).Scan(&codeVerifier, &linkUserID, &expiresAt)
+	if err != nil || time.Now().After(expiresAt) {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "OAuth state expired or unknown"}
+	}
+	// Single use: consume the state regardless of what happens next.
+	if _, err := db.Exec(ctx, `DELETE FROM oauth_states WHERE id = $1`, params.State); err != nil {
+		rlog.Error("failed to consume OAuth state", "error", err)
+	}
+
+	token, err := p.Exchange(ctx, params.Code, codeVerifier)
+	if err != nil {
+		rlog.Error("OAuth code exchange failed", "error", err, "provider", provider)
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "failed to complete OAuth login"}
+	}
+	info, err := p.UserInfo(ctx, token)
+	if err != nil || info.Email == "" {
+		rlog.Error("OAuth userinfo fetch failed", "error", err, "provider", provider)
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "failed to complete OAuth login"}
+	}
+
+	userID, err := resolveOAuthUser(ctx, provider, info, linkUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	encAccess, err := oauth.EncryptToken(token.AccessToken)
+	if err != nil {
+		rlog.Error("failed to encrypt OAuth access token", "error", err, "provider", provider)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to complete OAuth login"}
+	}
+	encRefresh, err := oauth.EncryptToken(token.RefreshToken)
+	if err != nil {
+		rlog.Error("failed to encrypt OAuth refresh token", "error", err, "provider", provider)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to complete OAuth login"}
+	}
+	if _, err := db.Exec(ctx, `
+		INSERT INTO oauth_identities (provider, provider_user_id, user_id, email, access_token_encrypted, refresh_token_encrypted)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (provider, provider_user_id)
+		DO UPDATE SET access_token_encrypted = $5, refresh_token_encrypted = $6
+	`, provider, info.ProviderUserID, userID, info.Email, encAccess, encRefresh); err != nil {
+		rlog.Error("failed to store OAuth identity", "error", err, "provider", provider)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to complete OAuth login"}
+	}
+
+	var user User
+	if err := db.QueryRow(ctx, `
+		SELECT id, email, password FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.Password); err != nil {
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to load user"}
+	}
+
+	pair, err := issueTokenPair(ctx, user)
+	if err != nil {
+		rlog.Error("failed to issue token pair", "error", err, "user_id", user.ID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to issue session tokens"}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &user.ID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "oauth_login", Resource: provider})
+
+	return pair, nil
+}
+
+// resolveOAuthUser finds or creates the local user an OAuth login maps to:
+// an existing identity logs in as its linked user, an authenticated
+// start-time session links the new identity to that user, and otherwise a
+// brand-new account is created. It never merges an unauthenticated OAuth
+// identity into a pre-existing local account by email alone — doing so
+// would let anyone who controls an email address log in as whoever
+// registered that email first. A user who already has a password account
+// must log in and link the provider explicitly instead.
+func resolveOAuthUser(ctx context.Context, provider string, info *oauth.UserInfo, linkUserID *int64) (int64, error) {
+	var userID int64
+	err := db.QueryRow(ctx, `
+		SELECT user_id FROM oauth_identities WHERE provider = $1 AND provider_user_id = $2
+	`, provider, info.ProviderUserID).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+
+	if linkUserID != nil {
+		return *linkUserID, nil
+	}
+
+	randomPw, err := randomToken(32)
+	if err != nil {
+		return 0, &errs.Error{Code: errs.Internal, Message: "failed to create user"}
+	}
+	hashedPw, err := bcrypt.GenerateFromPassword([]byte(randomPw), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, &errs.Error{Code: errs.Internal, Message: "failed to create user"}
+	}
+
+	result, err := db.Exec(ctx, `
+		INSERT INTO users (email, password)
+		VALUES ($1, $2)
+		ON CONFLICT (email) DO NOTHING
+	`, info.Email, string(hashedPw))
+	if err != nil {
+		rlog.Error("failed to auto-create user for OAuth login", "error", err, "provider", provider)
+		return 0, &errs.Error{Code: errs.Internal, Message: "failed to create user"}
+	}
+	if result.RowsAffected() == 0 {
+		return 0, &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "an account with this email already exists; log in and link this provider from your account instead",
+		}
+	}
+
+	if err := db.QueryRow(ctx, `
+		SELECT id FROM users WHERE email = $1
+	`, info.Email).Scan(&userID); err != nil {
+		rlog.Error("failed to load newly created OAuth user", "error", err, "provider", provider)
+		return 0, &errs.Error{Code: errs.Internal, Message: "failed to create user"}
+	}
+	return userID, nil
+}
@@ -0,0 +1,35 @@
+package authapi
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"encore.dev/beta/errs"
+)
+
+// minPasswordLength is the shortest password Signup and password reset will accept.
+const minPasswordLength = 12
+
+// validatePasswordStrength enforces the account password policy: at least
+// minPasswordLength characters, with at least one non-alphanumeric
+// character. Shared by Signup and the password reset flow so the two can't
+// drift apart.
+func validatePasswordStrength(password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "password must be at least 12 characters",
+		}
+	}
+
+	for _, r := range password {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return nil
+		}
+	}
+
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: "password must contain at least one non-alphanumeric character",
+	}
+}
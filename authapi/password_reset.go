@@ -0,0 +1,136 @@
+package authapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"encore-secure-api-backend/authapi/audit"
+
+	"encore.dev/beta/errs"
+	"encore.dev/pubsub"
+	"encore.dev/rlog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTokenTTL bounds how long a forgot-password link stays valid.
+const passwordResetTokenTTL = 30 * time.Minute
+
+// PasswordResetRequested is published whenever a password reset is
+// requested, so an email service can deliver the reset link.
+type PasswordResetRequested struct {
+	UserID int64
+	Email  string
+	Token  string // raw, unhashed token; only ever available at request time
+}
+
+// PasswordResetTopic carries PasswordResetRequested events.
+var PasswordResetTopic = pubsub.NewTopic[*PasswordResetRequested]("password-reset-requested", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+// ForgotPasswordParams identifies the account to send a reset link to.
+type ForgotPasswordParams struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword always responds successfully, whether or not the email is
+// registered, to avoid leaking which addresses have accounts.
+//
+//encore:api public method=POST path=/password/forgot
+func ForgotPassword(ctx context.Context, params *ForgotPasswordParams) (*struct{}, error) {
+	var userID int64
+	err := db.QueryRow(ctx, `SELECT id FROM users WHERE email = $1`, params.Email).Scan(&userID)
+	if err != nil {
+		return &struct{}{}, nil
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		rlog.Error("failed to generate password reset token", "error", err)
+		return &struct{}{}, nil
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, hashToken(raw), time.Now().Add(passwordResetTokenTTL))
+	if err != nil {
+		rlog.Error("failed to store password reset token", "error", err, "user_id", userID)
+		return &struct{}{}, nil
+	}
+
+	if _, err := PasswordResetTopic.Publish(ctx, &PasswordResetRequested{
+		UserID: userID,
+		Email:  params.Email,
+		Token:  raw,
+	}); err != nil {
+		rlog.Error("failed to publish password reset event", "error", err, "user_id", userID)
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &userID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "password_reset_requested"})
+
+	return &struct{}{}, nil
+}
+
+// ResetPasswordParams carries the token from the reset email and the new password.
+type ResetPasswordParams struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+//encore:api public method=POST path=/password/reset
+func ResetPassword(ctx context.Context, params *ResetPasswordParams) (*struct{}, error) {
+	if err := validatePasswordStrength(params.NewPassword); err != nil {
+		return nil, err
+	}
+
+	wantHash := hashToken(params.Token)
+
+	var (
+		id         int64
+		userID     int64
+		storedHash string
+		expiresAt  time.Time
+		usedAt     *time.Time
+	)
+	err := db.QueryRow(ctx, `
+		SELECT id, user_id, token_hash, expires_at, used_at
+		FROM password_resets
+		WHERE token_hash = $1
+	`, wantHash).Scan(&id, &userID, &storedHash, &expiresAt, &usedAt)
+	if err != nil || subtle.ConstantTimeCompare([]byte(storedHash), []byte(wantHash)) != 1 {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid or expired reset token"}
+	}
+	if usedAt != nil || time.Now().After(expiresAt) {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid or expired reset token"}
+	}
+
+	hashedPw, err := bcrypt.GenerateFromPassword([]byte(params.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		rlog.Error("failed to hash new password", "error", err, "user_id", userID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to reset password"}
+	}
+
+	if _, err := db.Exec(ctx, `UPDATE users SET password = $1 WHERE id = $2`, string(hashedPw), userID); err != nil {
+		rlog.Error("failed to update password", "error", err, "user_id", userID)
+		return nil, &errs.Error{Code: errs.Internal, Message: "failed to reset password"}
+	}
+	if _, err := db.Exec(ctx, `UPDATE password_resets SET used_at = now() WHERE id = $1`, id); err != nil {
+		rlog.Error("failed to mark reset token used", "error", err, "user_id", userID)
+	}
+	if err := revokeAllRefreshTokens(ctx, userID); err != nil {
+		rlog.Error("failed to revoke refresh tokens after password reset", "error", err, "user_id", userID)
+	}
+	if _, err := db.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID); err != nil {
+		rlog.Error("failed to revoke API keys after password reset", "error", err, "user_id", userID)
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &userID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "password_reset_completed"})
+
+	return &struct{}{}, nil
+}
@@ -0,0 +1,210 @@
+package authapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"encore-secure-api-backend/authapi/audit"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// refreshTokenTTL is how long a refresh token remains valid before it must
+// be rotated via /refresh.
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// TokenPair is the JWT access/refresh pair returned by Signup, Login and Refresh.
+type TokenPair struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"` // access token lifetime, in seconds
+}
+
+// generateRefreshToken creates a new raw refresh token, persists its hash
+// for the given user, and returns the raw (unhashed) token to send to the
+// client.
+func generateRefreshToken(ctx context.Context, userID int64) (string, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, hashToken(raw), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// issueTokenPair generates a new access token and refresh token for user.
+func issueTokenPair(ctx context.Context, user User) (*TokenPair, error) {
+	access, err := generateAccessToken(user)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := generateRefreshToken(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshParams carries the refresh token presented by the client.
+type RefreshParams struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshTokenRow mirrors a row of the refresh_tokens table.
+type refreshTokenRow struct {
+	ID        int64
+	UserID    int64
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+//encore:api public method=POST path=/refresh
+func Refresh(ctx context.Context, params *RefreshParams) (*TokenPair, error) {
+	if params.RefreshToken == "" {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "refresh_token is required",
+		}
+	}
+
+	hash := hashToken(params.RefreshToken)
+
+	var row refreshTokenRow
+	err := db.QueryRow(ctx, `
+		SELECT id, user_id, expires_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`, hash).Scan(&row.ID, &row.UserID, &row.ExpiresAt, &row.RevokedAt)
+	if err != nil {
+		return nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid refresh token",
+		}
+	}
+
+	// Reuse of an already-revoked token indicates the token was stolen and
+	// used by both the legitimate client and an attacker: revoke the whole
+	// session family for this user.
+	if row.RevokedAt != nil {
+		rlog.Error("refresh token reuse detected", "user_id", row.UserID)
+		if err := revokeAllRefreshTokens(ctx, row.UserID); err != nil {
+			rlog.Error("failed to revoke refresh tokens after reuse detection", "error", err, "user_id", row.UserID)
+		}
+		return nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "refresh token has been revoked",
+		}
+	}
+
+	if time.Now().After(row.ExpiresAt) {
+		return nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "refresh token expired",
+		}
+	}
+
+	var user User
+	err = db.QueryRow(ctx, `
+		SELECT id, email, password
+		FROM users
+		WHERE id = $1
+	`, row.UserID).Scan(&user.ID, &user.Email, &user.Password)
+	if err != nil {
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "failed to load user",
+		}
+	}
+
+	if _, err := db.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now() WHERE id = $1
+	`, row.ID); err != nil {
+		rlog.Error("failed to revoke rotated refresh token", "error", err)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "failed to rotate refresh token",
+		}
+	}
+
+	pair, err := issueTokenPair(ctx, user)
+	if err != nil {
+		rlog.Error("failed to issue token pair", "error", err)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "failed to issue new tokens",
+		}
+	}
+	return pair, nil
+}
+
+//encore:api public method=POST path=/logout
+func Logout(ctx context.Context, params *RefreshParams) (*struct{}, error) {
+	if params.RefreshToken == "" {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "refresh_token is required",
+		}
+	}
+
+	var userID int64
+	err := db.QueryRow(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE token_hash = $1 AND revoked_at IS NULL
+		RETURNING user_id
+	`, hashToken(params.RefreshToken)).Scan(&userID)
+	if err == sqldb.ErrNoRows {
+		// Already revoked or unknown: logout is idempotent either way.
+		return &struct{}{}, nil
+	}
+	if err != nil {
+		rlog.Error("failed to revoke refresh token on logout", "error", err)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "failed to log out",
+		}
+	}
+
+	meta := requestMetaFromContext(ctx)
+	audit.Record(ctx, audit.Event{UserID: &userID, ActorIP: meta.IP, UserAgent: meta.UserAgent, Type: "logout"})
+
+	return &struct{}{}, nil
+}
+
+func revokeAllRefreshTokens(ctx context.Context, userID int64) error {
+	_, err := db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}